@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	basicAuthTableHeaderRe = regexp.MustCompile(`^\s*\[(\S+)\]\s*$`)
+	basicAuthEntryRe       = regexp.MustCompile(`^\s*(\S+)\s*=\s*"((?:[^"\\]|\\.)*)"\s*(#.*)?$`)
+)
+
+// parseBasicAuthUsers reads the `[basic_auth_users]` table directly out of
+// the TOML config file, bypassing viper: viper lowercases every key in its
+// config map while reading the file (spf13/viper#373), so UnmarshalKey and
+// Get would both silently reject a configured username containing
+// uppercase letters. This keeps usernames case-sensitive at the cost of
+// only supporting the `key = "value"` table form, which is all
+// basic_auth_users needs.
+func parseBasicAuthUsers(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	users := map[string]string{}
+	inTable := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if m := basicAuthTableHeaderRe.FindStringSubmatch(line); m != nil {
+			inTable = m[1] == "basic_auth_users"
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		if m := basicAuthEntryRe.FindStringSubmatch(line); m != nil {
+			users[m[1]] = m[2]
+		}
+	}
+	return users, nil
+}
+
+// basicAuthMiddleware wraps next with HTTP Basic Auth, checking the
+// supplied password against the bcrypt hash configured for that user in
+// basic_auth_users. It is a no-op passthrough when no users are configured.
+func basicAuthMiddleware(next http.Handler, users map[string]string) http.Handler {
+	if len(users) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		hash, known := users[username]
+		if !ok || !known || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="monit_exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// buildTLSConfig builds the server tls.Config for listen_address from the
+// configured cert/key/CA files. It returns nil, nil when neither a TLS cert
+// nor a TLS key is configured, meaning the caller should fall back to plain
+// HTTP.
+func buildTLSConfig(c *Config) (*tls.Config, error) {
+	if c.web_tls_cert_file == "" && c.web_tls_key_file == "" {
+		if c.web_client_ca_file != "" {
+			return nil, fmt.Errorf("web_client_ca_file is set but web_tls_cert_file/web_tls_key_file are not; mTLS requires TLS to be enabled")
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if c.web_client_ca_file != "" {
+		caCert, err := ioutil.ReadFile(c.web_client_ca_file)
+		if err != nil {
+			return nil, err
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("unable to parse client CA file: %s", c.web_client_ca_file)
+		}
+		tlsConfig.ClientCAs = caPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
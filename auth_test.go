@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestParseBasicAuthUsersPreservesCase guards against viper's config-map
+// lowercasing (spf13/viper#373) silently reintroducing itself: a
+// mixed-case username must round-trip through parseBasicAuthUsers and be
+// accepted by basicAuthMiddleware.
+func TestParseBasicAuthUsersPreservesCase(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	contents := "listen_address = \"localhost:9388\"\n\n[basic_auth_users]\nAdminUser = \"" + string(hash) + "\"\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	users, err := parseBasicAuthUsers(path)
+	if err != nil {
+		t.Fatalf("parseBasicAuthUsers: %v", err)
+	}
+	if _, ok := users["AdminUser"]; !ok {
+		t.Fatalf("expected mixed-case username %q to be preserved, got %v", "AdminUser", users)
+	}
+
+	handler := basicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), users)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth("AdminUser", "hunter2")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected mixed-case username to authenticate, got status %d", rec.Code)
+	}
+
+	reqLower := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	reqLower.SetBasicAuth("adminuser", "hunter2")
+	recLower := httptest.NewRecorder()
+	handler.ServeHTTP(recLower, reqLower)
+
+	if recLower.Code != http.StatusUnauthorized {
+		t.Fatalf("expected lowercased username to be rejected, got status %d", recLower.Code)
+	}
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/prometheus/common/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // EjabberdConnectedUserInfo is an item of the list retured by the /api/connected_users_info service
@@ -20,26 +23,57 @@ type EjabberdConnectedUserInfo struct {
 	Uptime     int
 }
 
-// FetchAndParseEjabberdStatus return the list of connected users from Jabber
-func FetchAndParseEjabberdStatus(c *Config) ([]EjabberdConnectedUserInfo, error) {
+// FetchEjabberdStatus fetches the raw response of the ejabberd
+// connected_users_info API.
+func FetchEjabberdStatus(ctx context.Context, c *Config) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "ejabberd.fetch")
+	defer span.End()
+	span.SetAttributes(attribute.String("target", c.ejabberd_uri))
+
 	req, err := http.NewRequest("POST", c.ejabberd_uri+"/api/connected_users_info", bytes.NewBufferString("{}"))
 	if err != nil {
 		log.Errorf("Unable to create request: %v", err)
 		return nil, err
 	}
+	req = req.WithContext(ctx)
+	if c.ejabberd_auth_token != "" {
+		req.Header.Set("X-Admin", "true")
+		req.Header.Set("Authorization", "Bearer "+c.ejabberd_auth_token)
+	}
+
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Error("Unable to fetch ejabberd status")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatal("Unable to read ejabberd status")
+		log.Errorf("Unable to read ejabberd status: %v", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
+	span.SetAttributes(attribute.Int("http.response_bytes", len(data)))
+	return data, nil
+}
+
+// ParseEjabberdStatus decodes the JSON response of the ejabberd
+// connected_users_info API.
+func ParseEjabberdStatus(ctx context.Context, data []byte) ([]EjabberdConnectedUserInfo, error) {
+	_, span := tracer.Start(ctx, "ejabberd.parse")
+	defer span.End()
+
 	var ejabberd []EjabberdConnectedUserInfo
-	json.Unmarshal(data, &ejabberd)
-	return ejabberd, nil
+	err := json.Unmarshal(data, &ejabberd)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return ejabberd, err
 }
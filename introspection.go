@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/common/log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is shared by every function in the scrape path so spans nest under
+// a single parent per Collect() call.
+var tracer = otel.Tracer("monit_exporter")
+
+// setupTracing wires up an OpenTelemetry TracerProvider from the configured
+// trace_exporter ("stdout", "jaeger" or "none") and installs it as the
+// global provider. The returned function must be called before the process
+// exits to flush pending spans.
+func setupTracing(c *Config) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch c.trace_exporter {
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "jaeger":
+		exporter, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(c.trace_endpoint)))
+	case "none", "":
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		return noop, nil
+	default:
+		log.Errorf("Unknown trace_exporter %q, disabling tracing", c.trace_exporter)
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		return noop, nil
+	}
+	if err != nil {
+		return noop, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("monit_exporter"),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// startIntrospectionServer mounts net/http/pprof on its own listener so
+// profiling traffic never competes with Prometheus scrapes on
+// listen_address. It is a no-op when introspection_address is unset.
+func startIntrospectionServer(c *Config) {
+	if c.introspection_address == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	log.Infof("Starting introspection listener: %s", c.introspection_address)
+	go func() {
+		log.Error(http.ListenAndServe(c.introspection_address, mux))
+	}()
+}
@@ -2,18 +2,29 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/xml"
 	"flag"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/common/log"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/net/html/charset"
 )
 
@@ -45,59 +56,182 @@ type monitService struct {
 	Name      string `xml:"name"`
 	Status    int    `xml:"status"`
 	Monitored string `xml:"monitor"`
+	Pid       int    `xml:"pid"`
+	Uptime    int64  `xml:"uptime"`
+
+	Memory *monitMemory `xml:"memory"`
+	CPU    *monitCPU    `xml:"cpu"`
+	System *monitSystem `xml:"system"`
+	Port   *monitPort   `xml:"port"`
+	Inode  *monitUsage  `xml:"inode"`
+	Block  *monitUsage  `xml:"block"`
+	Link   *monitLink   `xml:"link"`
 }
 
-// Exporter collects monit stats from the given URI and exports them using
-// the prometheus metrics package.
-type Exporter struct {
-	config *Config
-	mutex  sync.RWMutex
-	client *http.Client
+type monitMemory struct {
+	Percent       float64 `xml:"percent"`
+	PercentTotal  float64 `xml:"percenttotal"`
+	Kilobyte      int64   `xml:"kilobyte"`
+	KilobyteTotal int64   `xml:"kilobytetotal"`
+}
 
-	up                   prometheus.Gauge
-	checkStatus          *prometheus.GaugeVec
-	connectedUsersUptime *prometheus.GaugeVec // CounterVec one day?
-	connectedUsersCount  prometheus.Gauge
+type monitCPU struct {
+	Percent      float64 `xml:"percent"`
+	PercentTotal float64 `xml:"percenttotal"`
 }
 
-type Config struct {
-	listen_address   string
-	metrics_path     string
-	ignore_ssl       bool
-	monit_scrape_uri string
-	monit_user       string
-	monit_password   string
-	ejabberd_uri     string
+type monitLoad struct {
+	Avg01 float64 `xml:"avg01"`
+	Avg05 float64 `xml:"avg05"`
+	Avg15 float64 `xml:"avg15"`
+}
+
+// monitSystemCPU is monit's "system" service CPU shape, which breaks usage
+// down by user/system/wait time rather than the percent/percenttotal pair
+// used by every other service type.
+type monitSystemCPU struct {
+	User   float64 `xml:"user"`
+	System float64 `xml:"system"`
+	Wait   float64 `xml:"wait"`
+}
+
+// monitSystem is only populated for the "system" service monit reports for
+// the host it runs on.
+type monitSystem struct {
+	Load   monitLoad      `xml:"load"`
+	CPU    monitSystemCPU `xml:"cpu"`
+	Memory monitMemory    `xml:"memory"`
+	Swap   monitMemory    `xml:"swap"`
+}
+
+type monitPort struct {
+	ResponseTime float64 `xml:"responsetime"`
+}
+
+// monitUsage covers monit's filesystem percentage checks (inode, block).
+type monitUsage struct {
+	Percent float64 `xml:"percent"`
 }
 
-func FetchMonitStatus(c *Config) ([]byte, error) {
-	client := &http.Client{
+type monitLinkDirection struct {
+	BytesTotal int64 `xml:"bytes>total"`
+}
+
+// monitLink is only populated for "network" services.
+type monitLink struct {
+	State    int                `xml:"state"`
+	Speed    float64            `xml:"speed"`
+	Download monitLinkDirection `xml:"download"`
+	Upload   monitLinkDirection `xml:"upload"`
+}
+
+// Device is a single monit instance to scrape, as declared by a `[[monit]]`
+// block in the config file.
+type Device struct {
+	Name      string `mapstructure:"name"`
+	URI       string `mapstructure:"uri"`
+	User      string `mapstructure:"user"`
+	Password  string `mapstructure:"password"`
+	IgnoreSSL bool   `mapstructure:"ignore_ssl"`
+
+	mu sync.Mutex
+}
+
+func (d *Device) client() *http.Client {
+	return &http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: c.ignore_ssl},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: d.IgnoreSSL},
 		},
 	}
+}
+
+// Exporter collects monit stats from the configured devices and exports them
+// using the prometheus metrics package.
+type Exporter struct {
+	config *Config
+
+	up                   *prometheus.Desc
+	checkStatus          *prometheus.Desc
+	scrapeDuration       *prometheus.Desc
+	scrapeSuccess        *prometheus.Desc
+	serviceMemoryBytes   *prometheus.Desc
+	serviceCPUPercent    *prometheus.Desc
+	serviceUptime        *prometheus.Desc
+	servicePortResponse  *prometheus.Desc
+	systemLoad           *prometheus.Desc
+	systemCPU            *prometheus.Desc
+	serviceDiskUsed      *prometheus.Desc
+	serviceNetworkBytes  *prometheus.Desc
+	connectedUserInfo    *prometheus.Desc
+	connectedUsersByNode *prometheus.Desc
+	connectedUsersCount  *prometheus.Desc
+
+	scrapesTotal        prometheus.Counter
+	parseFailuresTotal  prometheus.Counter
+	fetchFailuresTotal  prometheus.Counter
+	lastScrapeTimestamp prometheus.Gauge
+
+	ejabberdHostFilter *regexp.Regexp
+}
+
+type Config struct {
+	listen_address        string
+	metrics_path          string
+	devices               []Device
+	modules               map[string]ModuleConfig
+	ejabberd_uri          string
+	introspection_address string
+	trace_exporter        string
+	trace_endpoint        string
+	web_tls_cert_file     string
+	web_tls_key_file      string
+	web_client_ca_file    string
+	basic_auth_users      map[string]string
+	ejabberd_enabled      bool
+	ejabberd_host_filter  string
+	ejabberd_auth_token   string
+}
+
+func FetchMonitStatus(ctx context.Context, d *Device) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "monit.fetch")
+	defer span.End()
+	span.SetAttributes(attribute.String("target", d.URI))
+
+	client := d.client()
 
-	req, err := http.NewRequest("GET", c.monit_scrape_uri, nil)
+	req, err := http.NewRequest("GET", d.URI, nil)
 	if err != nil {
 		log.Errorf("Unable to create request: %v", err)
+		return nil, err
 	}
+	req = req.WithContext(ctx)
 
-	req.SetBasicAuth(c.monit_user, c.monit_password)
+	req.SetBasicAuth(d.User, d.Password)
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Error("Unable to fetch monit status")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatal("Unable to read monit status")
+		log.Errorf("Unable to read monit status: %v", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
-	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response_bytes", len(data)))
 	return data, nil
 }
 
-func ParseMonitStatus(data []byte) (monitXML, error) {
+func ParseMonitStatus(ctx context.Context, data []byte) (monitXML, error) {
+	_, span := tracer.Start(ctx, "monit.parse")
+	defer span.End()
+
 	var statusChunk monitXML
 	reader := bytes.NewReader(data)
 	decoder := xml.NewDecoder(reader)
@@ -105,6 +239,10 @@ func ParseMonitStatus(data []byte) (monitXML, error) {
 	// Parsing status results to structure
 	decoder.CharsetReader = charset.NewReaderLabel
 	err := decoder.Decode(&statusChunk)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 	return statusChunk, err
 }
 
@@ -115,11 +253,17 @@ func ParseConfig() *Config {
 
 	v.SetDefault("listen_address", "localhost:9388")
 	v.SetDefault("metrics_path", "/metrics")
-	v.SetDefault("ignore_ssl", false)
 	v.SetDefault("monit_scrape_uri", "http://localhost:2812/_status?format=xml&level=full")
-	v.SetDefault("monit_user", "")
-	v.SetDefault("monit_password", "")
 	v.SetDefault("ejabberd_uri", "http://localhost:5280")
+	v.SetDefault("introspection_address", "")
+	v.SetDefault("trace_exporter", "none")
+	v.SetDefault("trace_endpoint", "")
+	v.SetDefault("web_tls_cert_file", "")
+	v.SetDefault("web_tls_key_file", "")
+	v.SetDefault("web_client_ca_file", "")
+	v.SetDefault("ejabberd_enabled", false)
+	v.SetDefault("ejabberd_host_filter", "")
+	v.SetDefault("ejabberd_auth_token", "")
 	v.SetConfigFile(*configFile)
 	v.SetConfigType("toml")
 	err := v.ReadInConfig() // Find and read the config file
@@ -127,44 +271,173 @@ func ParseConfig() *Config {
 		log.Infof("Error reading config file: %s. Using defaults.", err)
 	}
 
+	var devices []Device
+	if err := v.UnmarshalKey("monit", &devices); err != nil {
+		log.Errorf("Unable to parse [[monit]] blocks: %v", err)
+	}
+	if len(devices) == 0 {
+		// Fall back to the old single-target keys so existing configs keep working.
+		devices = append(devices, Device{
+			Name:      "default",
+			URI:       v.GetString("monit_scrape_uri"),
+			User:      v.GetString("monit_user"),
+			Password:  v.GetString("monit_password"),
+			IgnoreSSL: v.GetBool("ignore_ssl"),
+		})
+	}
+
+	var modules map[string]ModuleConfig
+	if err := v.UnmarshalKey("modules", &modules); err != nil {
+		log.Errorf("Unable to parse [modules.*] blocks: %v", err)
+	}
+	if modules == nil {
+		modules = map[string]ModuleConfig{}
+	}
+	if _, ok := modules["default"]; !ok {
+		modules["default"] = ModuleConfig{}
+	}
+
+	// viper lowercases every key in its config map while reading the file,
+	// which would silently reject any configured username containing
+	// uppercase letters; parse the table straight from the file instead to
+	// keep usernames case-sensitive.
+	basicAuthUsers, err := parseBasicAuthUsers(*configFile)
+	if err != nil {
+		log.Infof("Unable to read basic_auth_users from %s: %v. No users configured.", *configFile, err)
+		basicAuthUsers = map[string]string{}
+	}
+
 	return &Config{
-		listen_address:   v.GetString("listen_address"),
-		metrics_path:     v.GetString("metrics_path"),
-		ignore_ssl:       v.GetBool("ignore_ssl"),
-		monit_scrape_uri: v.GetString("monit_scrape_uri"),
-		monit_user:       v.GetString("monit_user"),
-		monit_password:   v.GetString("monit_password"),
-		ejabberd_uri:     v.GetString("ejabberd_uri"),
+		listen_address:        v.GetString("listen_address"),
+		metrics_path:          v.GetString("metrics_path"),
+		devices:               devices,
+		modules:               modules,
+		ejabberd_uri:          v.GetString("ejabberd_uri"),
+		introspection_address: v.GetString("introspection_address"),
+		trace_exporter:        v.GetString("trace_exporter"),
+		trace_endpoint:        v.GetString("trace_endpoint"),
+		web_tls_cert_file:     v.GetString("web_tls_cert_file"),
+		web_tls_key_file:      v.GetString("web_tls_key_file"),
+		web_client_ca_file:    v.GetString("web_client_ca_file"),
+		basic_auth_users:      basicAuthUsers,
+		ejabberd_enabled:      v.GetBool("ejabberd_enabled"),
+		ejabberd_host_filter:  v.GetString("ejabberd_host_filter"),
+		ejabberd_auth_token:   v.GetString("ejabberd_auth_token"),
 	}
 }
 
 // Returns an initialized Exporter.
 func NewExporter(c *Config) (*Exporter, error) {
+	var hostFilter *regexp.Regexp
+	if c.ejabberd_host_filter != "" {
+		var err error
+		hostFilter, err = regexp.Compile(c.ejabberd_host_filter)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &Exporter{
 		config: c,
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "exporter_up"),
+			"Monit status availability",
+			[]string{"device"}, nil,
+		),
+		checkStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "exporter_service_check"),
+			"Monit service check info",
+			[]string{"check_name", "type", "monitored", "device"}, nil,
+		),
+		scrapeDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape_collector", "duration_seconds"),
+			"Duration of a collector scrape for one device",
+			[]string{"device"}, nil,
+		),
+		scrapeSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape_collector", "success"),
+			"Whether a collector scrape succeeded for one device",
+			[]string{"device"}, nil,
+		),
+		serviceMemoryBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "memory_bytes"),
+			"Current memory usage of the service in bytes",
+			[]string{"check_name", "device"}, nil,
+		),
+		serviceCPUPercent: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "cpu_percent"),
+			"Current CPU usage of the service in percent",
+			[]string{"check_name", "device"}, nil,
+		),
+		serviceUptime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "uptime_seconds"),
+			"Uptime of the service in seconds",
+			[]string{"check_name", "device"}, nil,
+		),
+		servicePortResponse: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "port_response_seconds"),
+			"Response time of the service's port check in seconds",
+			[]string{"check_name", "device"}, nil,
+		),
+		systemLoad: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "system", "load"),
+			"System load average reported by the monit system service",
+			[]string{"window", "device"}, nil,
+		),
+		systemCPU: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "system", "cpu_percent"),
+			"System CPU usage in percent reported by the monit system service, broken down by mode",
+			[]string{"mode", "device"}, nil,
+		),
+		serviceDiskUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "disk_used_percent"),
+			"Used space in percent for a filesystem check",
+			[]string{"check_name", "kind", "device"}, nil,
+		),
+		serviceNetworkBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "service", "network_bytes_total"),
+			"Total bytes transferred on a network service's link",
+			[]string{"check_name", "direction", "device"}, nil,
+		),
+		connectedUserInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ejabberd", "connected_user_info"),
+			"Ejabberd connected user info",
+			[]string{"jid", "connection", "node", "ip", "port", "priority"}, nil,
+		),
+		connectedUsersByNode: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ejabberd", "connected_users_by_node"),
+			"Ejabberd connected users count per cluster node",
+			[]string{"node"}, nil,
+		),
+		connectedUsersCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "ejabberd_users"),
+			"Ejabberd total users count",
+			nil, nil,
+		),
+		ejabberdHostFilter: hostFilter,
+		scrapesTotal: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "exporter_up",
-			Help:      "Monit status availability",
+			Subsystem: "exporter",
+			Name:      "scrapes_total",
+			Help:      "Total number of times the exporter has been scraped",
 		}),
-		checkStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		parseFailuresTotal: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "exporter_service_check",
-			Help:      "Monit service check info",
-		},
-			[]string{"check_name", "type", "monitored"},
-		),
-		connectedUsersUptime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: "exporter",
+			Name:      "scrape_parse_failures_total",
+			Help:      "Total number of times a monit or ejabberd response failed to parse",
+		}),
+		fetchFailuresTotal: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "ejabberd_connected_users_uptime",
-			Help:      "Ejabberd connected users uptime",
-		},
-			[]string{"jid"}),
-		connectedUsersCount: prometheus.NewGauge(prometheus.GaugeOpts{
+			Subsystem: "exporter",
+			Name:      "scrape_fetch_failures_total",
+			Help:      "Total number of times a monit or ejabberd response failed to be fetched",
+		}),
+		lastScrapeTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "ejabberd_users",
-			Help:      "Ejabberd total users count",
+			Subsystem: "exporter",
+			Name:      "last_scrape_timestamp_seconds",
+			Help:      "Unix timestamp of the last scrape where at least one device's monit or ejabberd fetch and parse succeeded",
 		}),
 	}, nil
 }
@@ -172,59 +445,186 @@ func NewExporter(c *Config) (*Exporter, error) {
 // Describe describes all the metrics ever exported by the monit exporter. It
 // implements prometheus.Collector.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	e.up.Describe(ch)
-	e.checkStatus.Describe(ch)
-	e.connectedUsersCount.Describe(ch)
-	e.connectedUsersUptime.Describe(ch)
+	ch <- e.up
+	ch <- e.checkStatus
+	ch <- e.scrapeDuration
+	ch <- e.scrapeSuccess
+	ch <- e.serviceMemoryBytes
+	ch <- e.serviceCPUPercent
+	ch <- e.serviceUptime
+	ch <- e.servicePortResponse
+	ch <- e.systemLoad
+	ch <- e.systemCPU
+	ch <- e.serviceDiskUsed
+	ch <- e.serviceNetworkBytes
+	ch <- e.connectedUsersCount
+	ch <- e.connectedUserInfo
+	ch <- e.connectedUsersByNode
+	e.scrapesTotal.Describe(ch)
+	e.parseFailuresTotal.Describe(ch)
+	e.fetchFailuresTotal.Describe(ch)
+	e.lastScrapeTimestamp.Describe(ch)
 }
 
-func (e *Exporter) scrape() error {
-	data, err := FetchMonitStatus(e.config)
+// scrape fetches and parses a single device's monit status, emitting its
+// check metrics directly on ch.
+func (d *Device) scrape(ctx context.Context, ch chan<- prometheus.Metric, e *Exporter) error {
+	ctx, span := tracer.Start(ctx, "monit.scrape")
+	defer span.End()
+	span.SetAttributes(attribute.String("device", d.Name))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, err := FetchMonitStatus(ctx, d)
 	if err != nil {
-		// set "monit_exporter_up" gauge to 0, remove previous metrics from e.checkStatus vector
-		e.up.Set(0)
-		e.checkStatus.Reset()
-		log.Errorf("Error getting monit status: %v", err)
+		log.Errorf("Error getting monit status for %s: %v", d.Name, err)
+		e.fetchFailuresTotal.Inc()
+		ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, 0, d.Name)
 		return err
 	}
-	parsedData, err := ParseMonitStatus(data)
+	parsedData, err := ParseMonitStatus(ctx, data)
 	if err != nil {
-		e.up.Set(0)
-		e.checkStatus.Reset()
-		log.Errorf("Error parsing data from monit: %v", err)
+		log.Errorf("Error parsing data from monit for %s: %v", d.Name, err)
+		e.parseFailuresTotal.Inc()
+		ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, 0, d.Name)
 		return err
 	}
 
-	e.up.Set(1)
-	// Constructing metrics
+	ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, 1, d.Name)
 	for _, service := range parsedData.MonitServices {
-		e.checkStatus.With(prometheus.Labels{"check_name": service.Name, "type": serviceTypes[service.Type], "monitored": service.Monitored}).Set(float64(service.Status))
+		ch <- prometheus.MustNewConstMetric(e.checkStatus, prometheus.GaugeValue, float64(service.Status),
+			service.Name, serviceTypes[service.Type], service.Monitored, d.Name)
+
+		if service.Uptime > 0 {
+			ch <- prometheus.MustNewConstMetric(e.serviceUptime, prometheus.GaugeValue, float64(service.Uptime), service.Name, d.Name)
+		}
+		if service.CPU != nil {
+			ch <- prometheus.MustNewConstMetric(e.serviceCPUPercent, prometheus.GaugeValue, service.CPU.Percent, service.Name, d.Name)
+		}
+		if service.Memory != nil {
+			ch <- prometheus.MustNewConstMetric(e.serviceMemoryBytes, prometheus.GaugeValue, float64(service.Memory.Kilobyte)*1024, service.Name, d.Name)
+		}
+		if service.Port != nil {
+			ch <- prometheus.MustNewConstMetric(e.servicePortResponse, prometheus.GaugeValue, service.Port.ResponseTime, service.Name, d.Name)
+		}
+		if service.Inode != nil {
+			ch <- prometheus.MustNewConstMetric(e.serviceDiskUsed, prometheus.GaugeValue, service.Inode.Percent, service.Name, "inode", d.Name)
+		}
+		if service.Block != nil {
+			ch <- prometheus.MustNewConstMetric(e.serviceDiskUsed, prometheus.GaugeValue, service.Block.Percent, service.Name, "block", d.Name)
+		}
+		if service.Link != nil {
+			ch <- prometheus.MustNewConstMetric(e.serviceNetworkBytes, prometheus.GaugeValue, float64(service.Link.Download.BytesTotal), service.Name, "download", d.Name)
+			ch <- prometheus.MustNewConstMetric(e.serviceNetworkBytes, prometheus.GaugeValue, float64(service.Link.Upload.BytesTotal), service.Name, "upload", d.Name)
+		}
+		if service.System != nil {
+			ch <- prometheus.MustNewConstMetric(e.systemLoad, prometheus.GaugeValue, service.System.Load.Avg01, "avg01", d.Name)
+			ch <- prometheus.MustNewConstMetric(e.systemLoad, prometheus.GaugeValue, service.System.Load.Avg05, "avg05", d.Name)
+			ch <- prometheus.MustNewConstMetric(e.systemLoad, prometheus.GaugeValue, service.System.Load.Avg15, "avg15", d.Name)
+			ch <- prometheus.MustNewConstMetric(e.systemCPU, prometheus.GaugeValue, service.System.CPU.User, "user", d.Name)
+			ch <- prometheus.MustNewConstMetric(e.systemCPU, prometheus.GaugeValue, service.System.CPU.System, "system", d.Name)
+			ch <- prometheus.MustNewConstMetric(e.systemCPU, prometheus.GaugeValue, service.System.CPU.Wait, "wait", d.Name)
+			ch <- prometheus.MustNewConstMetric(e.serviceMemoryBytes, prometheus.GaugeValue, float64(service.System.Memory.Kilobyte)*1024, service.Name, d.Name)
+		}
+	}
+
+	return nil
+}
+
+// scrapeEjabberd fetches and parses the ejabberd status, emitting its
+// metrics directly on ch so concurrent Collect calls never share mutable
+// state (the same approach Device.scrape uses for monit metrics). It
+// returns false only when ejabberd is enabled and the fetch or parse
+// failed, so a disabled ejabberd collector never counts as a failed scrape.
+func (e *Exporter) scrapeEjabberd(ctx context.Context, ch chan<- prometheus.Metric) bool {
+	if !e.config.ejabberd_enabled {
+		return true
 	}
 
-	jabberData, err := FetchAndParseEjabberdStatus(e.config)
+	data, err := FetchEjabberdStatus(ctx, e.config)
 	if err != nil {
-		return err
+		log.Errorf("Error getting ejabberd status: %v", err)
+		e.fetchFailuresTotal.Inc()
+		return false
+	}
+	jabberData, err := ParseEjabberdStatus(ctx, data)
+	if err != nil {
+		log.Errorf("Error parsing ejabberd status: %v", err)
+		e.parseFailuresTotal.Inc()
+		return false
 	}
+
+	byNode := map[string]int{}
+	count := 0
 	for _, user := range jabberData {
-		e.connectedUsersUptime.With(prometheus.Labels{"jid": user.Jid}).Set(float64(user.Uptime))
+		if e.ejabberdHostFilter != nil && !e.ejabberdHostFilter.MatchString(jidDomain(user.Jid)) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(e.connectedUserInfo, prometheus.GaugeValue, 1,
+			user.Jid, user.Connection, user.Node, user.Ip, strconv.Itoa(user.Port), strconv.Itoa(user.Priority))
+		byNode[user.Node]++
+		count++
+	}
+	for node, n := range byNode {
+		ch <- prometheus.MustNewConstMetric(e.connectedUsersByNode, prometheus.GaugeValue, float64(n), node)
 	}
-	e.connectedUsersCount.Set(float64(len(jabberData)))
+	ch <- prometheus.MustNewConstMetric(e.connectedUsersCount, prometheus.GaugeValue, float64(count))
+	return true
+}
 
-	return nil
+// jidDomain returns the domain part of a "user@domain" or
+// "user@domain/resource" ejabberd JID.
+func jidDomain(jid string) string {
+	at := strings.IndexByte(jid, '@')
+	if at < 0 {
+		return jid
+	}
+	domain := jid[at+1:]
+	if slash := strings.IndexByte(domain, '/'); slash >= 0 {
+		domain = domain[:slash]
+	}
+	return domain
 }
 
-// Collect fetches the stats from configured monit location and delivers them
+// Collect fetches the stats from every configured device and delivers them
 // as Prometheus metrics. It implements prometheus.Collector.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	e.mutex.Lock() // Protect metrics from concurrent collects.
-	defer e.mutex.Unlock()
-	e.checkStatus.Reset()
-	e.scrape()
-	e.up.Collect(ch)
-	e.checkStatus.Collect(ch)
-	e.connectedUsersCount.Collect(ch)
-	e.connectedUsersUptime.Collect(ch)
-	return
+	e.scrapesTotal.Inc()
+
+	ctx, span := tracer.Start(context.Background(), "monit_exporter.collect")
+	defer span.End()
+
+	var wg sync.WaitGroup
+	var anySuccess int32
+	wg.Add(len(e.config.devices))
+	for i := range e.config.devices {
+		go func(d *Device) {
+			defer wg.Done()
+			begin := time.Now()
+			err := d.scrape(ctx, ch, e)
+			ch <- prometheus.MustNewConstMetric(e.scrapeDuration, prometheus.GaugeValue, time.Since(begin).Seconds(), d.Name)
+			ok := 1.0
+			if err != nil {
+				ok = 0.0
+			} else {
+				atomic.StoreInt32(&anySuccess, 1)
+			}
+			ch <- prometheus.MustNewConstMetric(e.scrapeSuccess, prometheus.GaugeValue, ok, d.Name)
+		}(&e.config.devices[i])
+	}
+	wg.Wait()
+
+	if e.scrapeEjabberd(ctx, ch) && e.config.ejabberd_enabled {
+		atomic.StoreInt32(&anySuccess, 1)
+	}
+	e.scrapesTotal.Collect(ch)
+	e.parseFailuresTotal.Collect(ch)
+	e.fetchFailuresTotal.Collect(ch)
+	if atomic.LoadInt32(&anySuccess) == 1 {
+		e.lastScrapeTimestamp.Set(float64(time.Now().Unix()))
+	}
+	e.lastScrapeTimestamp.Collect(ch)
 }
 
 func main() {
@@ -237,8 +637,28 @@ func main() {
 	}
 	prometheus.MustRegister(exporter)
 
+	shutdownTracing, err := setupTracing(config)
+	if err != nil {
+		log.Errorf("Unable to set up tracing: %v", err)
+	}
+
+	// main never returns (it ends in log.Fatal), so a plain defer would
+	// never run; flush the tracer on termination signals instead.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		shutdownTracing(context.Background())
+		os.Exit(0)
+	}()
+
+	startIntrospectionServer(config)
+
 	log.Infof("Starting monit_exporter: %s", config.listen_address)
-	http.Handle(config.metrics_path, promhttp.Handler())
+	http.Handle(config.metrics_path, basicAuthMiddleware(promhttp.Handler(), config.basic_auth_users))
+	http.Handle("/probe", basicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r, config)
+	}), config.basic_auth_users))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
             <head><title>Monit Exporter</title></head>
@@ -249,5 +669,13 @@ func main() {
             </html>`))
 	})
 
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		log.Fatalf("Unable to build TLS config: %v", err)
+	}
+	if tlsConfig != nil {
+		server := &http.Server{Addr: config.listen_address, TLSConfig: tlsConfig}
+		log.Fatal(server.ListenAndServeTLS(config.web_tls_cert_file, config.web_tls_key_file))
+	}
 	log.Fatal(http.ListenAndServe(config.listen_address, nil))
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// monitStatusFixture is a trimmed monit `level=full` status document
+// covering a filesystem (inode/block usage), a program with a pidfile
+// (cpu/memory/uptime), a network link, and the host's own "system"
+// service. It has no port check, so port response times are not covered.
+const monitStatusFixture = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<monit>
+  <service type="0">
+    <name>rootfs</name>
+    <status>0</status>
+    <monitor>1</monitor>
+    <inode><percent>12.3</percent></inode>
+    <block><percent>45.6</percent></block>
+  </service>
+  <service type="3">
+    <name>myapp</name>
+    <status>0</status>
+    <monitor>1</monitor>
+    <pid>1234</pid>
+    <uptime>3600</uptime>
+    <memory>
+      <percent>2.5</percent>
+      <percenttotal>1.1</percenttotal>
+      <kilobyte>10240</kilobyte>
+      <kilobytetotal>20480</kilobytetotal>
+    </memory>
+    <cpu>
+      <percent>0.5</percent>
+      <percenttotal>0.2</percenttotal>
+    </cpu>
+  </service>
+  <service type="8">
+    <name>eth0</name>
+    <status>0</status>
+    <monitor>1</monitor>
+    <link>
+      <state>1</state>
+      <speed>1000</speed>
+      <download><bytes><total>123456</total></bytes></download>
+      <upload><bytes><total>654321</total></bytes></upload>
+    </link>
+  </service>
+  <service type="5">
+    <name>myhost</name>
+    <status>0</status>
+    <monitor>1</monitor>
+    <system>
+      <load>
+        <avg01>0.1</avg01>
+        <avg05>0.2</avg05>
+        <avg15>0.3</avg15>
+      </load>
+      <cpu>
+        <user>10</user>
+        <system>5</system>
+        <wait>1</wait>
+      </cpu>
+      <memory>
+        <percent>50</percent>
+        <kilobyte>1048576</kilobyte>
+      </memory>
+      <swap>
+        <percent>1</percent>
+        <kilobyte>2048</kilobyte>
+      </swap>
+    </system>
+  </service>
+</monit>
+`
+
+func TestParseMonitStatus(t *testing.T) {
+	parsed, err := ParseMonitStatus(context.Background(), []byte(monitStatusFixture))
+	if err != nil {
+		t.Fatalf("ParseMonitStatus: %v", err)
+	}
+	if len(parsed.MonitServices) != 4 {
+		t.Fatalf("expected 4 services, got %d", len(parsed.MonitServices))
+	}
+
+	byName := map[string]monitService{}
+	for _, s := range parsed.MonitServices {
+		byName[s.Name] = s
+	}
+
+	fs, ok := byName["rootfs"]
+	if !ok {
+		t.Fatal("missing rootfs service")
+	}
+	if fs.Inode == nil || fs.Inode.Percent != 12.3 {
+		t.Errorf("rootfs.Inode = %+v, want percent 12.3", fs.Inode)
+	}
+	if fs.Block == nil || fs.Block.Percent != 45.6 {
+		t.Errorf("rootfs.Block = %+v, want percent 45.6", fs.Block)
+	}
+
+	app, ok := byName["myapp"]
+	if !ok {
+		t.Fatal("missing myapp service")
+	}
+	if app.Pid != 1234 {
+		t.Errorf("myapp.Pid = %d, want 1234", app.Pid)
+	}
+	if app.Uptime != 3600 {
+		t.Errorf("myapp.Uptime = %d, want 3600", app.Uptime)
+	}
+	if app.Memory == nil || app.Memory.Kilobyte != 10240 {
+		t.Errorf("myapp.Memory = %+v, want kilobyte 10240", app.Memory)
+	}
+	if app.CPU == nil || app.CPU.Percent != 0.5 {
+		t.Errorf("myapp.CPU = %+v, want percent 0.5", app.CPU)
+	}
+
+	net, ok := byName["eth0"]
+	if !ok {
+		t.Fatal("missing eth0 service")
+	}
+	if net.Link == nil {
+		t.Fatal("eth0.Link is nil")
+	}
+	if net.Link.Download.BytesTotal != 123456 {
+		t.Errorf("eth0.Link.Download.BytesTotal = %d, want 123456", net.Link.Download.BytesTotal)
+	}
+	if net.Link.Upload.BytesTotal != 654321 {
+		t.Errorf("eth0.Link.Upload.BytesTotal = %d, want 654321", net.Link.Upload.BytesTotal)
+	}
+
+	host, ok := byName["myhost"]
+	if !ok {
+		t.Fatal("missing myhost service")
+	}
+	if host.System == nil {
+		t.Fatal("myhost.System is nil")
+	}
+	if host.System.Load.Avg01 != 0.1 || host.System.Load.Avg05 != 0.2 || host.System.Load.Avg15 != 0.3 {
+		t.Errorf("myhost.System.Load = %+v, want {0.1 0.2 0.3}", host.System.Load)
+	}
+	if host.System.CPU.User != 10 || host.System.CPU.System != 5 || host.System.CPU.Wait != 1 {
+		t.Errorf("myhost.System.CPU = %+v, want {10 5 1}", host.System.CPU)
+	}
+	if host.System.Memory.Kilobyte != 1048576 {
+		t.Errorf("myhost.System.Memory.Kilobyte = %d, want 1048576", host.System.Memory.Kilobyte)
+	}
+}
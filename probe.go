@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+// ModuleConfig holds the credentials and options used to probe an ad-hoc
+// target under a given module name, configured via `[modules.<name>]`
+// blocks.
+type ModuleConfig struct {
+	User      string `mapstructure:"user"`
+	Password  string `mapstructure:"password"`
+	IgnoreSSL bool   `mapstructure:"ignore_ssl"`
+}
+
+// probeHandler implements a blackbox_exporter-style /probe endpoint: it
+// scrapes the monit instance given by the `target` query parameter, using
+// the credentials of the `module` query parameter (default module
+// otherwise), and serves the result as a one-shot set of metrics.
+func probeHandler(w http.ResponseWriter, r *http.Request, c *Config) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = "default"
+	}
+	module, ok := c.modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	dev := &Device{
+		Name:      target,
+		URI:       target,
+		User:      module.User,
+		Password:  module.Password,
+		IgnoreSSL: module.IgnoreSSL,
+	}
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "monit_probe_success",
+		Help: "Whether the probe of the target succeeded",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "monit_probe_duration_seconds",
+		Help: "Duration of the monit probe in seconds",
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeSuccess, probeDuration)
+
+	ctx, span := tracer.Start(r.Context(), "monit.probe")
+	defer span.End()
+
+	begin := time.Now()
+	data, err := FetchMonitStatus(ctx, dev)
+	if err != nil {
+		log.Errorf("Probe of %s failed: %v", target, err)
+		probeSuccess.Set(0)
+	} else if parsedData, err := ParseMonitStatus(ctx, data); err != nil {
+		log.Errorf("Probe of %s failed to parse: %v", target, err)
+		probeSuccess.Set(0)
+	} else {
+		registry.MustRegister(&probeCollector{services: parsedData.MonitServices})
+		probeSuccess.Set(1)
+	}
+	probeDuration.Set(time.Since(begin).Seconds())
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+var (
+	probeCheckStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "service_check"),
+		"Monit service check info for the probed target",
+		[]string{"check_name", "type", "monitored"}, nil,
+	)
+	probeServiceMemoryBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "memory_bytes"),
+		"Current memory usage of the service in bytes",
+		[]string{"check_name"}, nil,
+	)
+	probeServiceCPUPercent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "cpu_percent"),
+		"Current CPU usage of the service in percent",
+		[]string{"check_name"}, nil,
+	)
+	probeServiceUptime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "uptime_seconds"),
+		"Uptime of the service in seconds",
+		[]string{"check_name"}, nil,
+	)
+	probeServicePortResponse = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "port_response_seconds"),
+		"Response time of the service's port check in seconds",
+		[]string{"check_name"}, nil,
+	)
+	probeSystemLoad = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "system_load"),
+		"System load average reported by the monit system service",
+		[]string{"window"}, nil,
+	)
+	probeSystemCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "system_cpu_percent"),
+		"System CPU usage in percent reported by the monit system service, broken down by mode",
+		[]string{"mode"}, nil,
+	)
+	probeServiceDiskUsed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "disk_used_percent"),
+		"Used space in percent for a filesystem check",
+		[]string{"check_name", "kind"}, nil,
+	)
+	probeServiceNetworkBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "network_bytes_total"),
+		"Total bytes transferred on a network service's link",
+		[]string{"check_name", "direction"}, nil,
+	)
+)
+
+// probeCollector is a one-shot prometheus.Collector that emits the full
+// monit service telemetry for the services returned by a single probe, so
+// that scraping /probe surfaces the same kind of data a direct
+// monit_exporter_service_check scrape would.
+type probeCollector struct {
+	services []monitService
+}
+
+func (p *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- probeCheckStatus
+	ch <- probeServiceMemoryBytes
+	ch <- probeServiceCPUPercent
+	ch <- probeServiceUptime
+	ch <- probeServicePortResponse
+	ch <- probeSystemLoad
+	ch <- probeSystemCPU
+	ch <- probeServiceDiskUsed
+	ch <- probeServiceNetworkBytes
+}
+
+func (p *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, service := range p.services {
+		ch <- prometheus.MustNewConstMetric(probeCheckStatus, prometheus.GaugeValue, float64(service.Status),
+			service.Name, serviceTypes[service.Type], service.Monitored)
+
+		if service.Uptime > 0 {
+			ch <- prometheus.MustNewConstMetric(probeServiceUptime, prometheus.GaugeValue, float64(service.Uptime), service.Name)
+		}
+		if service.CPU != nil {
+			ch <- prometheus.MustNewConstMetric(probeServiceCPUPercent, prometheus.GaugeValue, service.CPU.Percent, service.Name)
+		}
+		if service.Memory != nil {
+			ch <- prometheus.MustNewConstMetric(probeServiceMemoryBytes, prometheus.GaugeValue, float64(service.Memory.Kilobyte)*1024, service.Name)
+		}
+		if service.Port != nil {
+			ch <- prometheus.MustNewConstMetric(probeServicePortResponse, prometheus.GaugeValue, service.Port.ResponseTime, service.Name)
+		}
+		if service.Inode != nil {
+			ch <- prometheus.MustNewConstMetric(probeServiceDiskUsed, prometheus.GaugeValue, service.Inode.Percent, service.Name, "inode")
+		}
+		if service.Block != nil {
+			ch <- prometheus.MustNewConstMetric(probeServiceDiskUsed, prometheus.GaugeValue, service.Block.Percent, service.Name, "block")
+		}
+		if service.Link != nil {
+			ch <- prometheus.MustNewConstMetric(probeServiceNetworkBytes, prometheus.GaugeValue, float64(service.Link.Download.BytesTotal), service.Name, "download")
+			ch <- prometheus.MustNewConstMetric(probeServiceNetworkBytes, prometheus.GaugeValue, float64(service.Link.Upload.BytesTotal), service.Name, "upload")
+		}
+		if service.System != nil {
+			ch <- prometheus.MustNewConstMetric(probeSystemLoad, prometheus.GaugeValue, service.System.Load.Avg01, "avg01")
+			ch <- prometheus.MustNewConstMetric(probeSystemLoad, prometheus.GaugeValue, service.System.Load.Avg05, "avg05")
+			ch <- prometheus.MustNewConstMetric(probeSystemLoad, prometheus.GaugeValue, service.System.Load.Avg15, "avg15")
+			ch <- prometheus.MustNewConstMetric(probeSystemCPU, prometheus.GaugeValue, service.System.CPU.User, "user")
+			ch <- prometheus.MustNewConstMetric(probeSystemCPU, prometheus.GaugeValue, service.System.CPU.System, "system")
+			ch <- prometheus.MustNewConstMetric(probeSystemCPU, prometheus.GaugeValue, service.System.CPU.Wait, "wait")
+			ch <- prometheus.MustNewConstMetric(probeServiceMemoryBytes, prometheus.GaugeValue, float64(service.System.Memory.Kilobyte)*1024, service.Name)
+		}
+	}
+}